@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"regexp"
+)
+
+type apkPackageManager struct{}
+
+func newApkPackageManager() PackageManager {
+	return &apkPackageManager{}
+}
+
+func (pm *apkPackageManager) binary() string {
+	return "apk"
+}
+
+func (pm *apkPackageManager) Name() string {
+	return "apk"
+}
+
+// apkInstalledRe splits an `apk info -v` entry, e.g. "musl-1.2.2-r7", into
+// its name and version components.
+var apkInstalledRe = regexp.MustCompile(`^(.+)-([0-9][^-]*-r\d+)$`)
+
+func (pm *apkPackageManager) ListInstalled() ([]*Package, error) {
+	out, err := exec.Command("apk", "info", "-v").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		ms := apkInstalledRe.FindStringSubmatch(sc.Text())
+		if ms == nil {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:    ms[1],
+				Version: ms[2],
+				Suites:  []string{"installed"},
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+// apkUpgradeableRe matches an `apk list --upgradable` entry, e.g.
+//
+//	musl-1.2.3-r0 x86_64 {musl} (MIT) [upgradable from: musl-1.2.2-r7]
+var apkUpgradeableRe = regexp.MustCompile(`^(.+)-([0-9][^-]*-r\d+) (\S+) \{(\S+)\}`)
+
+func (pm *apkPackageManager) ListUpgradeable() ([]*Package, error) {
+	out, err := exec.Command("apk", "list", "--upgradable").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		ms := apkUpgradeableRe.FindStringSubmatch(sc.Text())
+		if ms == nil {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:         ms[1],
+				Version:      ms[2],
+				Suites:       []string{ms[4]},
+				Architecture: ms[3],
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+func (pm *apkPackageManager) NeedsReboot() (bool, error) {
+	// Alpine does not ship a standard reboot-required marker.
+	return false, nil
+}
+
+func (pm *apkPackageManager) WatchPaths() []string {
+	return []string{
+		"/var/cache/apk",
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pmaene/apt_exporter/internal/dpkg"
+)
+
+const (
+	dpkgStatusPath = "/var/lib/dpkg/status"
+	aptListsGlob   = "/var/lib/apt/lists/*_Packages"
+	aptSourcesGlob = "/etc/apt/sources.list.d/*.list"
+	aptSourcesMain = "/etc/apt/sources.list"
+)
+
+type aptPackageManager struct{}
+
+func newAptPackageManager() PackageManager {
+	return &aptPackageManager{}
+}
+
+func (pm *aptPackageManager) binary() string {
+	return "apt"
+}
+
+func (pm *aptPackageManager) Name() string {
+	return "apt"
+}
+
+func (pm *aptPackageManager) ListInstalled() ([]*Package, error) {
+	installed, err := readDpkgStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	// Cached package lists are consulted to recover the release suite a
+	// given installed version belongs to, since dpkg's status file does
+	// not record it. A list read failure should not prevent installed
+	// packages from being reported.
+	cached, err := readAptLists()
+	if err != nil {
+		cached = nil
+	}
+	suitesByPkg := indexSuitesByNameVersion(cached)
+
+	ps := []*Package{}
+	for _, dp := range installed {
+		if !strings.Contains(dp.Status, "installed") {
+			continue
+		}
+
+		suites := append([]string{"now"}, suitesByPkg[dp.Name+"_"+dp.Version]...)
+
+		ps = append(
+			ps,
+			&Package{
+				Name:         dp.Name,
+				Version:      dp.Version,
+				Suites:       unique(suites),
+				Architecture: dp.Architecture,
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+func (pm *aptPackageManager) ListUpgradeable() ([]*Package, error) {
+	installed, err := readDpkgStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := readAptLists()
+	if err != nil {
+		return nil, err
+	}
+
+	// Origins are resolved on a best-effort basis: a sources.list.d that
+	// cannot be read should not prevent upgradeable packages from being
+	// reported.
+	origins, err := resolveAptOrigins()
+	if err != nil {
+		origins = map[string]string{}
+	}
+
+	candidates := highestCandidates(cached)
+
+	ps := []*Package{}
+	for _, dp := range installed {
+		if !strings.Contains(dp.Status, "installed") {
+			continue
+		}
+
+		c, ok := candidates[dp.Name+"_"+dp.Architecture]
+		if !ok || dpkg.CompareVersions(c.version, dp.Version) <= 0 {
+			continue
+		}
+
+		p := &Package{
+			Name:         dp.Name,
+			Version:      c.version,
+			Suites:       c.suites,
+			Architecture: dp.Architecture,
+		}
+
+		for _, s := range p.Suites {
+			if isAptSecuritySuite(s) {
+				p.Security = true
+			}
+
+			if o, ok := origins[s]; ok {
+				p.Origin = o
+			}
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+func (pm *aptPackageManager) NeedsReboot() (bool, error) {
+	_, err := os.Stat("/run/reboot-required")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (pm *aptPackageManager) WatchPaths() []string {
+	return []string{
+		"/var/log/apt/history.log",
+		"/var/lib/apt/periodic/",
+	}
+}
+
+// readDpkgStatus parses dpkg's status database directly, rather than
+// shelling out to `apt list --installed`.
+func readDpkgStatus() ([]*dpkg.Package, error) {
+	f, err := os.Open(dpkgStatusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return dpkg.ParsePackages(f, "")
+}
+
+// readAptLists parses every cached APT Packages list directly, rather
+// than shelling out to `apt list --upgradable`. Each list's release
+// suite is recovered from its file name (APT names cache files after the
+// dists/<suite>/<component> path they were fetched from).
+func readAptLists() ([]*dpkg.Package, error) {
+	fs, err := filepath.Glob(aptListsGlob)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*dpkg.Package{}
+	for _, p := range fs {
+		suite := aptSuiteFromListFilename(filepath.Base(p))
+
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+
+		dps, err := dpkg.ParsePackages(f, suite)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, dps...)
+	}
+
+	return ps, nil
+}
+
+// aptListSuiteRe extracts the release suite from an APT cache file name,
+// e.g. "security.debian.org_debian-security_dists_bullseye-security_main_binary-amd64_Packages".
+var aptListSuiteRe = regexp.MustCompile(`_dists_([A-Za-z0-9.+~-]+)_`)
+
+func aptSuiteFromListFilename(name string) string {
+	m := aptListSuiteRe.FindStringSubmatch(name)
+	if m == nil {
+		return "unknown"
+	}
+
+	return m[1]
+}
+
+// indexSuitesByNameVersion groups the suites a given name/version pair
+// was found in across cached package lists.
+func indexSuitesByNameVersion(ps []*dpkg.Package) map[string][]string {
+	idx := map[string][]string{}
+	for _, p := range ps {
+		k := p.Name + "_" + p.Version
+		idx[k] = append(idx[k], p.Suite)
+	}
+
+	return idx
+}
+
+type aptCandidate struct {
+	version string
+	suites  []string
+}
+
+// highestCandidates reduces cached package lists to, per name and
+// architecture, the highest available version and every suite serving
+// it.
+func highestCandidates(ps []*dpkg.Package) map[string]*aptCandidate {
+	best := map[string]*aptCandidate{}
+
+	for _, p := range ps {
+		k := p.Name + "_" + p.Architecture
+
+		c, ok := best[k]
+		if !ok {
+			best[k] = &aptCandidate{version: p.Version, suites: []string{p.Suite}}
+			continue
+		}
+
+		switch dpkg.CompareVersions(p.Version, c.version) {
+		case 1:
+			best[k] = &aptCandidate{version: p.Version, suites: []string{p.Suite}}
+		case 0:
+			c.suites = unique(append(c.suites, p.Suite))
+		}
+	}
+
+	return best
+}
+
+// aptAutoremovableCount returns the number of automatically-installed
+// packages that are no longer depended on, directly or transitively, by
+// any manually-installed package - i.e. the packages `apt autoremove`
+// would remove.
+func aptAutoremovableCount() (int, error) {
+	installed, err := readDpkgStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	auto, err := readAptAutoInstalled()
+	if err != nil {
+		return 0, err
+	}
+
+	byName := map[string]*dpkg.Package{}
+	for _, p := range installed {
+		if strings.Contains(p.Status, "installed") {
+			byName[p.Name] = p
+		}
+	}
+
+	reachable := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if reachable[name] {
+			return
+		}
+		reachable[name] = true
+
+		p, ok := byName[name]
+		if !ok {
+			return
+		}
+
+		for _, d := range parseDependencyNames(p.Depends) {
+			visit(d)
+		}
+	}
+
+	for name := range byName {
+		if !auto[name] {
+			visit(name)
+		}
+	}
+
+	n := 0
+	for name := range auto {
+		if !reachable[name] {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// parseDependencyNames extracts the plain package names referenced by a
+// Depends-style field (comma-separated alternatives, "|"-separated
+// choices within an alternative, each optionally version-constrained and
+// architecture-qualified, e.g. "libc6 (>= 2.31) | libc6-compat").
+func parseDependencyNames(field string) []string {
+	if field == "" {
+		return nil
+	}
+
+	names := []string{}
+	for _, alt := range strings.Split(field, ",") {
+		for _, opt := range strings.Split(alt, "|") {
+			fs := strings.Fields(opt)
+			if len(fs) == 0 {
+				continue
+			}
+
+			names = append(names, strings.SplitN(fs[0], ":", 2)[0])
+		}
+	}
+
+	return names
+}
+
+// readAptAutoInstalled parses /var/lib/apt/extended_states directly
+// (rather than shelling out to `apt-mark showauto`) and returns the set
+// of packages APT marked as automatically installed.
+func readAptAutoInstalled() (map[string]bool, error) {
+	f, err := os.Open("/var/lib/apt/extended_states")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	auto := map[string]bool{}
+
+	sc := dpkg.NewStanzaScanner(f)
+	for sc.Scan() {
+		st := sc.Stanza()
+		if st["Package"] != "" && st["Auto-Installed"] == "1" {
+			auto[st["Package"]] = true
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return auto, nil
+}
+
+// isAptSecuritySuite reports whether a suite name denotes a Debian/Ubuntu
+// security pocket (e.g. "bullseye-security", "focal-security").
+func isAptSecuritySuite(suite string) bool {
+	return strings.Contains(suite, "-security") || suite == "security"
+}
+
+// aptSourceRe matches a one-line sources.list(.d) entry, e.g.
+//
+//	deb http://security.debian.org/debian-security bullseye-security main
+var aptSourceRe = regexp.MustCompile(`^deb(?:-src)?\s+(?:\[[^\]]*\]\s+)?(\S+)\s+(\S+)`)
+
+// resolveAptOrigins builds a suite-to-origin-host map from
+// /etc/apt/sources.list and /etc/apt/sources.list.d/*.list, so that
+// upgradeable packages can be attributed to the repository serving them.
+func resolveAptOrigins() (map[string]string, error) {
+	paths := []string{aptSourcesMain}
+
+	ms, err := filepath.Glob(aptSourcesGlob)
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, ms...)
+
+	origins := map[string]string{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			m := aptSourceRe.FindStringSubmatch(sc.Text())
+			if m == nil {
+				continue
+			}
+
+			u, err := url.Parse(m[1])
+			if err != nil {
+				continue
+			}
+
+			origins[m[2]] = u.Hostname()
+		}
+		f.Close()
+	}
+
+	return origins, nil
+}
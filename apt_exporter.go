@@ -1,16 +1,13 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
-	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
@@ -21,109 +18,92 @@ import (
 	"github.com/prometheus/common/log"
 )
 
-type Package struct {
-	Name         string
-	Suites       []string
-	Architecture string
-}
-
 const (
 	CACHE_INSTALLED_PACKAGES   = "installed_packages"
 	CACHE_UPGRADEABLE_PACKAGES = "upgradeable_packages"
+	CACHE_APT_HISTORY          = "apt_history"
 )
 
 var version = ""
 
 var (
-	aptUpDesc = prometheus.NewDesc(
-		prometheus.BuildFQName("apt", "", "up"),
-		"Whether collecting APT's metrics was successful.",
+	pkgUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("pkg", "", "up"),
+		"Whether collecting the package manager's metrics was successful.",
 		nil,
 		nil,
 	)
-	aptRebootRequiredDesc = prometheus.NewDesc(
-		prometheus.BuildFQName("apt", "", "reboot_required"),
+	pkgRebootRequiredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("pkg", "", "reboot_required"),
 		"Whether a system restart is required.",
 		nil,
 		nil,
 	)
+	aptLastUpgradeTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt", "last_upgrade_timestamp", "seconds"),
+		"Unix timestamp of the most recent APT upgrade transaction.",
+		nil,
+		nil,
+	)
+	aptLastInstallTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt", "last_install_timestamp", "seconds"),
+		"Unix timestamp of the most recent APT install transaction.",
+		nil,
+		nil,
+	)
+	aptPackagesAutoremovableDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt", "", "packages_autoremovable"),
+		"How many automatically-installed APT packages are no longer depended on by any manually-installed package.",
+		nil,
+		nil,
+	)
 )
 
-func parseAptOutput(out []byte) []*Package {
-	re := regexp.MustCompile(`^([^ ]+)\/([^ ]+) [^ ]+ ([^ ]+)`)
+// PackageManagerExporter collects package metrics from the host's detected
+// PackageManager.
+type PackageManagerExporter struct {
+	manager PackageManager
 
-	ps := []*Package{}
-	sc := bufio.NewScanner(bytes.NewReader(out))
-	for sc.Scan() {
-		ms := re.FindAllStringSubmatch(sc.Text(), -1)
-		if len(ms) == 0 {
-			continue
-		}
-
-		ps = append(
-			ps,
-			&Package{
-				Name:         ms[0][1],
-				Suites:       unique(strings.Split(ms[0][2], ",")),
-				Architecture: ms[0][3],
-			},
-		)
-	}
-
-	return ps
-}
-
-func unique(src []string) []string {
-	dst := []string{}
-
-	mm := map[string]bool{}
-	for _, v := range src {
-		if !mm[v] {
-			mm[v] = true
-			dst = append(dst, v)
-		}
-	}
+	// perPackage enables the per-package apt_package_info metric. It is
+	// off by default because it carries one series per upgradeable
+	// package and can grow cardinality on hosts with many updates
+	// pending.
+	perPackage bool
 
-	return dst
-}
+	// onRefresh, if set, is called after every successful cache refresh
+	// (both the initial one and subsequent ones triggered by fsnotify or
+	// the textfile fallback timer). It drives the textfile-collector
+	// output mode.
+	onRefresh func()
 
-type AptExporter struct {
 	cache   *cache.Cache
 	watcher *fsnotify.Watcher
 }
 
-func (e *AptExporter) cacheInstalledPackages() error {
-	out, err := exec.Command("/usr/bin/apt", "list", "--installed").Output()
+func (e *PackageManagerExporter) cacheInstalledPackages() error {
+	ps, err := e.manager.ListInstalled()
 	if err != nil {
 		return err
 	}
 
-	e.cache.Set(
-		CACHE_INSTALLED_PACKAGES,
-		parseAptOutput(out),
-		cache.DefaultExpiration,
-	)
+	e.cache.Set(CACHE_INSTALLED_PACKAGES, ps, cache.DefaultExpiration)
 
 	log.Infoln("Cached installed packages")
 	return nil
 }
-func (e *AptExporter) cacheUpgradeablePackages() error {
-	out, err := exec.Command("/usr/bin/apt", "list", "--upgradable").Output()
+func (e *PackageManagerExporter) cacheUpgradeablePackages() error {
+	ps, err := e.manager.ListUpgradeable()
 	if err != nil {
 		return err
 	}
 
-	e.cache.Set(
-		CACHE_UPGRADEABLE_PACKAGES,
-		parseAptOutput(out),
-		cache.DefaultExpiration,
-	)
+	e.cache.Set(CACHE_UPGRADEABLE_PACKAGES, ps, cache.DefaultExpiration)
 
 	log.Infoln("Cached upgradeable packages")
 	return nil
 }
 
-func (e *AptExporter) collectInstalledPackages(ch chan<- prometheus.Metric) error {
+func (e *PackageManagerExporter) collectInstalledPackages(ch chan<- prometheus.Metric) error {
 	ps, f := e.cache.Get(CACHE_INSTALLED_PACKAGES)
 	if !f {
 		return fmt.Errorf(
@@ -132,24 +112,24 @@ func (e *AptExporter) collectInstalledPackages(ch chan<- prometheus.Metric) erro
 		)
 	}
 
-	aptPackagesInstalled := prometheus.NewCounterVec(
+	pkgPackagesInstalled := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "apt_packages_installed",
-			Help: "How many APT packages are installed by architecture and suite.",
+			Name: "pkg_packages_installed",
+			Help: "How many packages are installed by manager, architecture and suite.",
 		},
-		[]string{"architecture", "suite"},
+		[]string{"manager", "architecture", "suite"},
 	)
 
 	for _, p := range ps.([]*Package) {
 		for _, s := range p.Suites {
-			aptPackagesInstalled.WithLabelValues(s, p.Architecture).Inc()
+			pkgPackagesInstalled.WithLabelValues(e.manager.Name(), p.Architecture, s).Inc()
 		}
 	}
 
-	aptPackagesInstalled.Collect(ch)
+	pkgPackagesInstalled.Collect(ch)
 	return nil
 }
-func (e *AptExporter) collectUpgradeablePackages(ch chan<- prometheus.Metric) error {
+func (e *PackageManagerExporter) collectUpgradeablePackages(ch chan<- prometheus.Metric) error {
 	ps, f := e.cache.Get(CACHE_UPGRADEABLE_PACKAGES)
 	if !f {
 		return fmt.Errorf(
@@ -158,72 +138,199 @@ func (e *AptExporter) collectUpgradeablePackages(ch chan<- prometheus.Metric) er
 		)
 	}
 
-	aptPackagesUpgradeable := prometheus.NewCounterVec(
+	pkgPackagesUpgradeable := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "apt_packages_upgradeable",
-			Help: "How many APT packages are upgradeable by architecture and suite.",
+			Name: "pkg_packages_upgradeable",
+			Help: "How many packages are upgradeable by manager, architecture and suite.",
 		},
-		[]string{"architecture", "suite"},
+		[]string{"manager", "architecture", "suite"},
 	)
 
 	for _, p := range ps.([]*Package) {
 		for _, s := range p.Suites {
-			aptPackagesUpgradeable.WithLabelValues(p.Architecture, s).Inc()
+			pkgPackagesUpgradeable.WithLabelValues(e.manager.Name(), p.Architecture, s).Inc()
 		}
 	}
 
-	aptPackagesUpgradeable.Collect(ch)
+	pkgPackagesUpgradeable.Collect(ch)
 	return nil
 }
-func (e *AptExporter) collectRebootRequired(ch chan<- prometheus.Metric) {
-	_, err := os.Stat("/run/reboot-required")
-	if os.IsNotExist(err) {
+func (e *PackageManagerExporter) collectAptSecurityUpgrades(ch chan<- prometheus.Metric) error {
+	// Security suite classification and origin resolution are
+	// APT/Debian-specific concepts; other backends leave Package.Security
+	// false and Package.Origin empty, so there is nothing to report.
+	if e.manager.Name() != "apt" {
+		return nil
+	}
+
+	ps, f := e.cache.Get(CACHE_UPGRADEABLE_PACKAGES)
+	if !f {
+		return fmt.Errorf(
+			"Cache item with key \"%s\" does not exist",
+			CACHE_UPGRADEABLE_PACKAGES,
+		)
+	}
+
+	aptPackagesUpgradeableSecurity := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apt_packages_upgradeable_security",
+			Help: "How many APT packages with an outstanding security update are upgradeable, by architecture, suite and origin.",
+		},
+		[]string{"architecture", "suite", "origin"},
+	)
+
+	aptPackageInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apt_package_info",
+			Help: "Metadata about an upgradeable APT package. Always 1.",
+		},
+		[]string{"name", "version", "architecture", "suite", "origin"},
+	)
+
+	for _, p := range ps.([]*Package) {
+		for _, s := range p.Suites {
+			if p.Security {
+				aptPackagesUpgradeableSecurity.WithLabelValues(p.Architecture, s, p.Origin).Inc()
+			}
+
+			if e.perPackage {
+				aptPackageInfo.WithLabelValues(p.Name, p.Version, p.Architecture, s, p.Origin).Set(1)
+			}
+		}
+	}
+
+	aptPackagesUpgradeableSecurity.Collect(ch)
+	if e.perPackage {
+		aptPackageInfo.Collect(ch)
+	}
+
+	return nil
+}
+func (e *PackageManagerExporter) cacheAptHistory() error {
+	// history.log is an APT/Debian-specific artifact; other backends
+	// have nothing to parse here.
+	if e.manager.Name() != "apt" {
+		return nil
+	}
+
+	ts, err := readAllAptHistory()
+	if err != nil {
+		return err
+	}
+
+	s := summarizeAptHistory(ts)
+
+	n, err := aptAutoremovableCount()
+	if err != nil {
+		log.Errorln(err)
+	} else {
+		s.autoremovable = n
+	}
+
+	e.cache.Set(CACHE_APT_HISTORY, s, cache.DefaultExpiration)
+
+	log.Infoln("Cached APT history")
+	return nil
+}
+
+func (e *PackageManagerExporter) collectAptHistory(ch chan<- prometheus.Metric) error {
+	if e.manager.Name() != "apt" {
+		return nil
+	}
+
+	v, f := e.cache.Get(CACHE_APT_HISTORY)
+	if !f {
+		return fmt.Errorf(
+			"Cache item with key \"%s\" does not exist",
+			CACHE_APT_HISTORY,
+		)
+	}
+	s := v.(*aptHistorySummary)
+
+	aptHistoryTransactionsTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apt_history_transactions_total",
+			Help: "How many APT history.log transactions have occurred, by action.",
+		},
+		[]string{"action"},
+	)
+	for action, n := range s.transactions {
+		aptHistoryTransactionsTotal.WithLabelValues(action).Add(float64(n))
+	}
+	aptHistoryTransactionsTotal.Collect(ch)
+
+	if !s.lastUpgrade.IsZero() {
 		ch <- prometheus.MustNewConstMetric(
-			aptRebootRequiredDesc,
+			aptLastUpgradeTimestampDesc,
 			prometheus.GaugeValue,
-			0.0,
+			float64(s.lastUpgrade.Unix()),
+		)
+	}
+	if !s.lastInstall.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			aptLastInstallTimestampDesc,
+			prometheus.GaugeValue,
+			float64(s.lastInstall.Unix()),
 		)
-
-		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(
-		aptRebootRequiredDesc,
+		aptPackagesAutoremovableDesc,
 		prometheus.GaugeValue,
-		1.0,
+		float64(s.autoremovable),
 	)
+
+	return nil
+}
+
+func (e *PackageManagerExporter) collectRebootRequired(ch chan<- prometheus.Metric) {
+	r, err := e.manager.NeedsReboot()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	v := 0.0
+	if r {
+		v = 1.0
+	}
+
+	ch <- prometheus.MustNewConstMetric(pkgRebootRequiredDesc, prometheus.GaugeValue, v)
+}
+
+// refresh reloads both package caches and, if set, invokes onRefresh.
+func (e *PackageManagerExporter) refresh() error {
+	if err := e.cacheInstalledPackages(); err != nil {
+		return err
+	}
+	if err := e.cacheUpgradeablePackages(); err != nil {
+		return err
+	}
+	if err := e.cacheAptHistory(); err != nil {
+		return err
+	}
+
+	if e.onRefresh != nil {
+		e.onRefresh()
+	}
+
+	return nil
 }
 
-func (e *AptExporter) Close() {
+func (e *PackageManagerExporter) Close() {
 	e.watcher.Close()
 }
-func (e *AptExporter) Watch() error {
+func (e *PackageManagerExporter) Watch() error {
 	go func() {
 		for {
 			select {
-			case evt, ok := <-e.watcher.Events:
+			case _, ok := <-e.watcher.Events:
 				if !ok {
 					return
 				}
 
-				switch evt.Name {
-				case "/var/log/apt/history.log":
-					if err := e.cacheInstalledPackages(); err != nil {
-						log.Errorln(err)
-					}
-					if err := e.cacheUpgradeablePackages(); err != nil {
-						log.Errorln(err)
-					}
-
-				case "/var/lib/apt/periodic/update-stamp":
-					if err := e.cacheUpgradeablePackages(); err != nil {
-						log.Errorln(err)
-					}
-
-				case "/var/lib/apt/periodic/update-success-stamp":
-					if err := e.cacheUpgradeablePackages(); err != nil {
-						log.Errorln(err)
-					}
+				if err := e.refresh(); err != nil {
+					log.Errorln(err)
 				}
 
 			case err, ok := <-e.watcher.Errors:
@@ -236,58 +343,53 @@ func (e *AptExporter) Watch() error {
 		}
 	}()
 
-	if err := e.cacheInstalledPackages(); err != nil {
-		return err
-	}
-	if err := e.watcher.Add("/var/log/apt/history.log"); err != nil {
+	if err := e.refresh(); err != nil {
 		return err
 	}
 
-	if err := e.cacheUpgradeablePackages(); err != nil {
-		return err
-	}
-	if err := e.watcher.Add("/var/lib/apt/periodic/"); err != nil {
-		return err
+	for _, p := range e.manager.WatchPaths() {
+		if err := e.watcher.Add(p); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (e *AptExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- aptUpDesc
-	ch <- aptRebootRequiredDesc
+func (e *PackageManagerExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pkgUpDesc
+	ch <- pkgRebootRequiredDesc
+	ch <- aptLastUpgradeTimestampDesc
+	ch <- aptLastInstallTimestampDesc
+	ch <- aptPackagesAutoremovableDesc
 }
-func (e *AptExporter) Collect(ch chan<- prometheus.Metric) {
+func (e *PackageManagerExporter) Collect(ch chan<- prometheus.Metric) {
 	if err := e.collectInstalledPackages(ch); err != nil {
-		ch <- prometheus.MustNewConstMetric(
-			aptUpDesc,
-			prometheus.GaugeValue,
-			0.0,
-		)
-
+		ch <- prometheus.MustNewConstMetric(pkgUpDesc, prometheus.GaugeValue, 0.0)
 		return
 	}
 
 	if err := e.collectUpgradeablePackages(ch); err != nil {
-		ch <- prometheus.MustNewConstMetric(
-			aptUpDesc,
-			prometheus.GaugeValue,
-			0.0,
-		)
+		ch <- prometheus.MustNewConstMetric(pkgUpDesc, prometheus.GaugeValue, 0.0)
+		return
+	}
+
+	if err := e.collectAptSecurityUpgrades(ch); err != nil {
+		ch <- prometheus.MustNewConstMetric(pkgUpDesc, prometheus.GaugeValue, 0.0)
+		return
+	}
 
+	if err := e.collectAptHistory(ch); err != nil {
+		ch <- prometheus.MustNewConstMetric(pkgUpDesc, prometheus.GaugeValue, 0.0)
 		return
 	}
 
 	e.collectRebootRequired(ch)
 
-	ch <- prometheus.MustNewConstMetric(
-		aptUpDesc,
-		prometheus.GaugeValue,
-		1.0,
-	)
+	ch <- prometheus.MustNewConstMetric(pkgUpDesc, prometheus.GaugeValue, 1.0)
 }
 
-func NewAptExporter() (*AptExporter, error) {
+func NewPackageManagerExporter(m PackageManager, perPackage bool) (*PackageManagerExporter, error) {
 	c := cache.New(cache.NoExpiration, 0)
 
 	w, err := fsnotify.NewWatcher()
@@ -295,9 +397,11 @@ func NewAptExporter() (*AptExporter, error) {
 		return nil, err
 	}
 
-	return &AptExporter{
-		cache:   c,
-		watcher: w,
+	return &PackageManagerExporter{
+		manager:    m,
+		perPackage: perPackage,
+		cache:      c,
+		watcher:    w,
 	}, nil
 }
 
@@ -335,6 +439,66 @@ func main() {
 			"web.telemetry-path",
 			"Path under which to expose metrics.",
 		).Default("/metrics").String()
+		perPackage = kingpin.Flag(
+			"collector.per-package",
+			"Expose a per-package apt_package_info metric (increases cardinality).",
+		).Default("false").Bool()
+		textfileOutput = kingpin.Flag(
+			"textfile.output",
+			"Path to atomically write a node_exporter textfile-collector .prom file to on every cache refresh, instead of or alongside serving /metrics.",
+		).Default("").String()
+		textfileInterval = kingpin.Flag(
+			"textfile.interval",
+			"Fallback interval on which to refresh and rewrite the textfile output, for hosts where none of the watched paths change. 0 disables the fallback timer.",
+		).Default("5m").Duration()
+		oneshot = kingpin.Flag(
+			"oneshot",
+			"Write the textfile output once and exit instead of running as a daemon. Requires --textfile.output.",
+		).Default("false").Bool()
+		updateDisabled = kingpin.Flag(
+			"update.disabled",
+			"Disable the self-update poller and the /-/upgrade endpoint.",
+		).Default("true").Bool()
+		updateFeedURL = kingpin.Flag(
+			"update.feed-url",
+			"URL of a release feed returning {version, url, sha256, sig} JSON describing the latest release.",
+		).String()
+		updatePubKey = kingpin.Flag(
+			"update.pubkey",
+			"Path to the base64-encoded ed25519 public key releases are signed with.",
+		).String()
+		updateChannel = kingpin.Flag(
+			"update.channel",
+			"Release channel to check for updates.",
+		).Default("stable").Enum("stable", "unstable")
+		updateToken = kingpin.Flag(
+			"update.token",
+			"Bearer token required by POST /-/upgrade.",
+		).String()
+		updateCheckInterval = kingpin.Flag(
+			"update.check-interval",
+			"Interval on which to poll the release feed for updates.",
+		).Default("30m").Duration()
+		cveEnabled = kingpin.Flag(
+			"collector.cve",
+			"Enable the apt_package_vulnerabilities/apt_vulnerabilities_total collector.",
+		).Default("false").Bool()
+		cveFeedURL = kingpin.Flag(
+			"cve.feed-url",
+			"URL of the Debian Security Tracker (or compatible) JSON feed.",
+		).Default("https://security-tracker.debian.org/tracker/data/json").String()
+		cveCacheDir = kingpin.Flag(
+			"cve.cache-dir",
+			"Directory to cache the CVE feed in, so it survives restarts and network outages.",
+		).Default("/var/cache/apt_exporter/cve").String()
+		cveRefreshInterval = kingpin.Flag(
+			"cve.refresh-interval",
+			"Interval on which to refetch the CVE feed.",
+		).Default("6h").Duration()
+		cveMaxPackageSeries = kingpin.Flag(
+			"cve.max-package-series",
+			"Maximum number of outstanding findings to expose as apt_package_vulnerabilities before falling back to the aggregate apt_vulnerabilities_total.",
+		).Default("1000").Int()
 	)
 
 	log.AddFlags(kingpin.CommandLine)
@@ -351,20 +515,90 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
+	if *oneshot && *textfileOutput == "" {
+		log.Fatal("--oneshot requires --textfile.output to be set")
+		os.Exit(1)
+	}
+
 	log.Infoln("Starting", kingpin.CommandLine.Name, getBuildInfo().Version)
 
-	e, err := NewAptExporter()
+	m, err := detectPackageManager()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	log.Infoln("Detected package manager", m.Name())
+
+	e, err := NewPackageManagerExporter(m, *perPackage)
 	if err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
 	defer e.Close()
 
+	if *textfileOutput != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(e)
+
+		e.onRefresh = func() {
+			if err := writeTextfile(reg, *textfileOutput); err != nil {
+				log.Errorln(err)
+			}
+		}
+	}
+
 	if err := e.Watch(); err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
 
+	if *oneshot {
+		log.Infoln("Wrote", *textfileOutput, "and exiting (--oneshot)")
+		return
+	}
+
+	if !*updateDisabled {
+		pk, err := loadUpdatePubKey(*updatePubKey)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+
+		u := NewUpdater(*updateFeedURL, *updateChannel, pk, *updateToken, getBuildInfo().Version)
+		prometheus.MustRegister(u)
+		http.HandleFunc("/-/upgrade", u.ServeHTTP)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go u.Poll(*updateCheckInterval, stop)
+	}
+
+	if *cveEnabled {
+		if m.Name() != "apt" {
+			log.Warnln("--collector.cve only supports the apt backend; no vulnerabilities will be reported on", m.Name())
+		}
+
+		cv := NewCVECollector(*cveFeedURL, *cveCacheDir, *cveMaxPackageSeries, e)
+		prometheus.MustRegister(cv)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go cv.Poll(*cveRefreshInterval, stop)
+	}
+
+	if *textfileOutput != "" && *textfileInterval > 0 {
+		go func() {
+			t := time.NewTicker(*textfileInterval)
+			defer t.Stop()
+
+			for range t.C {
+				if err := e.refresh(); err != nil {
+					log.Errorln(err)
+				}
+			}
+		}()
+	}
+
 	prometheus.MustRegister(e)
 
 	http.Handle(*metricsPath, promhttp.Handler())
@@ -372,9 +606,9 @@ func main() {
 		_, err := w.Write(
 			[]byte(
 				`<html>
-				<head><title>APT Exporter</title></head>
+				<head><title>Package Exporter</title></head>
 				<body>
-				<h1>APT Exporter</h1>
+				<h1>Package Exporter</h1>
 				<p><a href='` + *metricsPath + `'>Metrics</a></p>
 				</body>
 				</html>`,
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pmaene/apt_exporter/internal/dpkg"
+)
+
+// AptHistoryPackageEntry is one package reference within an
+// Install/Upgrade/Remove/Purge field of an APT history.log transaction,
+// e.g. "vim:amd64 (2:8.2.2434-3+deb11u1, automatic)".
+type AptHistoryPackageEntry struct {
+	Name         string
+	Architecture string
+	OldVersion   string
+	NewVersion   string
+	Automatic    bool
+}
+
+// AptHistoryTransaction is one Start-Date/.../End-Date block from APT's
+// history.log.
+type AptHistoryTransaction struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Action    string
+	Packages  []AptHistoryPackageEntry
+}
+
+// aptHistoryActions maps the history.log fields that denote a
+// transaction outcome to the normalized action label used on
+// apt_history_transactions_total.
+var aptHistoryActions = map[string]string{
+	"Install": "install",
+	"Upgrade": "upgrade",
+	"Remove":  "remove",
+	"Purge":   "purge",
+}
+
+var aptHistoryTimeLayouts = []string{
+	"2006-01-02  15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func parseAptHistoryTime(s string) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+
+	var err error
+	for _, l := range aptHistoryTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// aptHistoryEntryRe matches one package reference within an
+// Install/Upgrade/Remove/Purge field, e.g. "bash:amd64 (5.1-2,
+// 5.1-2+deb11u1)".
+var aptHistoryEntryRe = regexp.MustCompile(`([^,\s:]+):(\S+) \(([^)]*)\)`)
+
+func parseAptHistoryPackages(field string) []AptHistoryPackageEntry {
+	ms := aptHistoryEntryRe.FindAllStringSubmatch(field, -1)
+
+	es := make([]AptHistoryPackageEntry, 0, len(ms))
+	for _, m := range ms {
+		e := AptHistoryPackageEntry{Name: m[1], Architecture: m[2]}
+
+		parts := strings.Split(m[3], ",")
+		for i, p := range parts {
+			parts[i] = strings.TrimSpace(p)
+		}
+
+		switch len(parts) {
+		case 1:
+			e.NewVersion = parts[0]
+		case 2:
+			if parts[1] == "automatic" {
+				e.NewVersion = parts[0]
+				e.Automatic = true
+			} else {
+				e.OldVersion, e.NewVersion = parts[0], parts[1]
+			}
+		case 3:
+			e.OldVersion, e.NewVersion = parts[0], parts[1]
+			e.Automatic = parts[2] == "automatic"
+		}
+
+		es = append(es, e)
+	}
+
+	return es
+}
+
+// parseAptHistory parses a stream in APT history.log's
+// Start-Date/Commandline/Install/Upgrade/Remove/Purge/End-Date block
+// format into transactions, one per action present in a block (a single
+// invocation can, for instance, both install and remove packages).
+// Blocks without a parseable Start-Date are skipped.
+func parseAptHistory(r io.Reader) ([]*AptHistoryTransaction, error) {
+	ts := []*AptHistoryTransaction{}
+
+	sc := dpkg.NewStanzaScanner(r)
+	for sc.Scan() {
+		st := sc.Stanza()
+
+		start, err := parseAptHistoryTime(st["Start-Date"])
+		if err != nil {
+			continue
+		}
+
+		end := start
+		if e, err := parseAptHistoryTime(st["End-Date"]); err == nil {
+			end = e
+		}
+
+		for field, action := range aptHistoryActions {
+			if st[field] == "" {
+				continue
+			}
+
+			ts = append(ts, &AptHistoryTransaction{
+				StartDate: start,
+				EndDate:   end,
+				Action:    action,
+				Packages:  parseAptHistoryPackages(st[field]),
+			})
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// readAllAptHistory parses /var/log/apt/history.log and any rotated
+// history.log.* files (plain or gzip-compressed), so that counters are
+// seeded with historical data on startup rather than only what has
+// happened since the exporter started watching.
+func readAllAptHistory() ([]*AptHistoryTransaction, error) {
+	paths := []string{"/var/log/apt/history.log"}
+
+	rotated, err := filepath.Glob("/var/log/apt/history.log.*")
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, rotated...)
+
+	all := []*AptHistoryTransaction{}
+	for _, p := range paths {
+		ts, err := readAptHistoryFile(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		all = append(all, ts...)
+	}
+
+	return all, nil
+}
+
+func readAptHistoryFile(path string) ([]*AptHistoryTransaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		r = gr
+	}
+
+	return parseAptHistory(r)
+}
+
+// aptHistorySummary aggregates parsed transactions into the counters and
+// timestamps exported as metrics.
+type aptHistorySummary struct {
+	transactions  map[string]int64
+	lastInstall   time.Time
+	lastUpgrade   time.Time
+	autoremovable int
+}
+
+func summarizeAptHistory(ts []*AptHistoryTransaction) *aptHistorySummary {
+	s := &aptHistorySummary{transactions: map[string]int64{}}
+
+	for _, t := range ts {
+		s.transactions[t.Action]++
+
+		switch t.Action {
+		case "install":
+			if t.EndDate.After(s.lastInstall) {
+				s.lastInstall = t.EndDate
+			}
+		case "upgrade":
+			if t.EndDate.After(s.lastUpgrade) {
+				s.lastUpgrade = t.EndDate
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAptHistoryPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []AptHistoryPackageEntry
+	}{
+		{
+			name:  "new install",
+			field: "vim:amd64 (2:8.2.2434-3+deb11u1, automatic)",
+			want: []AptHistoryPackageEntry{
+				{Name: "vim", Architecture: "amd64", NewVersion: "2:8.2.2434-3+deb11u1", Automatic: true},
+			},
+		},
+		{
+			name:  "upgrade",
+			field: "bash:amd64 (5.1-2, 5.1-2+deb11u1)",
+			want: []AptHistoryPackageEntry{
+				{Name: "bash", Architecture: "amd64", OldVersion: "5.1-2", NewVersion: "5.1-2+deb11u1"},
+			},
+		},
+		{
+			name:  "upgrade marked automatic",
+			field: "libfoo:amd64 (1.0, 1.1, automatic)",
+			want: []AptHistoryPackageEntry{
+				{Name: "libfoo", Architecture: "amd64", OldVersion: "1.0", NewVersion: "1.1", Automatic: true},
+			},
+		},
+		{
+			name:  "multiple packages",
+			field: "foo:amd64 (1.0), bar:amd64 (2.0, automatic)",
+			want: []AptHistoryPackageEntry{
+				{Name: "foo", Architecture: "amd64", NewVersion: "1.0"},
+				{Name: "bar", Architecture: "amd64", NewVersion: "2.0", Automatic: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAptHistoryPackages(tt.field)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseAptHistoryPackages(%q) = %+v, want %+v", tt.field, got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAptHistory(t *testing.T) {
+	const log = `Start-Date: 2021-11-02  08:14:11
+Commandline: apt upgrade
+Upgrade: bash:amd64 (5.1-1, 5.1-2), vim:amd64 (2:8.2.2433-1, 2:8.2.2434-3+deb11u1, automatic)
+End-Date: 2021-11-02  08:14:15
+
+Start-Date: 2021-11-03  09:00:00
+Commandline: apt install curl
+Install: curl:amd64 (7.74.0-1.3+deb11u1)
+End-Date: 2021-11-03  09:00:02
+`
+
+	ts, err := parseAptHistory(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("parseAptHistory: %v", err)
+	}
+
+	if len(ts) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(ts))
+	}
+
+	up := ts[0]
+	if up.Action != "upgrade" {
+		t.Errorf("ts[0].Action = %q, want upgrade", up.Action)
+	}
+	if len(up.Packages) != 2 {
+		t.Fatalf("ts[0].Packages = %+v, want 2 entries", up.Packages)
+	}
+	if up.StartDate.IsZero() || up.EndDate.Before(up.StartDate) {
+		t.Errorf("ts[0] has an invalid date range: %v - %v", up.StartDate, up.EndDate)
+	}
+
+	inst := ts[1]
+	if inst.Action != "install" {
+		t.Errorf("ts[1].Action = %q, want install", inst.Action)
+	}
+	if len(inst.Packages) != 1 || inst.Packages[0].Name != "curl" {
+		t.Errorf("ts[1].Packages = %+v", inst.Packages)
+	}
+}
+
+func TestParseAptHistorySkipsBlocksWithoutStartDate(t *testing.T) {
+	const log = `Commandline: apt upgrade
+Upgrade: bash:amd64 (5.1-1, 5.1-2)
+End-Date: 2021-11-02  08:14:15
+`
+
+	ts, err := parseAptHistory(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("parseAptHistory: %v", err)
+	}
+
+	if len(ts) != 0 {
+		t.Fatalf("got %d transactions, want 0", len(ts))
+	}
+}
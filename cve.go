@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/pmaene/apt_exporter/internal/dpkg"
+)
+
+const (
+	cveFeedCacheFile = "debian-security-tracker.json"
+	cveFeedETagFile  = "debian-security-tracker.etag"
+)
+
+// cveHTTPClient bounds how long a feed fetch may take, so a stalled
+// connection to the feed server cannot block the refresh loop (and with
+// it, the ability to pick up the next tick or observe Poll's stop
+// channel) indefinitely.
+var cveHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// debianSecurityTrackerRelease is one distribution's status for a CVE
+// against a single package, as reported by the Debian Security Tracker's
+// JSON feed (https://security-tracker.debian.org/tracker/data/json).
+type debianSecurityTrackerRelease struct {
+	Status       string `json:"status"`
+	FixedVersion string `json:"fixed_version"`
+	Urgency      string `json:"urgency"`
+}
+
+type debianSecurityTrackerEntry struct {
+	Releases map[string]debianSecurityTrackerRelease `json:"releases"`
+}
+
+// debianSecurityTrackerFeed is keyed by package name, then by CVE
+// identifier.
+type debianSecurityTrackerFeed map[string]map[string]debianSecurityTrackerEntry
+
+// CVEFinding is an outstanding vulnerability affecting an installed
+// package.
+type CVEFinding struct {
+	Package      string
+	Architecture string
+	CVE          string
+	Severity     string
+	FixedVersion string
+	Status       string
+}
+
+var (
+	aptPackageVulnerabilitiesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt", "package", "vulnerabilities"),
+		"Outstanding CVEs affecting an installed APT package.",
+		[]string{"package", "architecture", "severity", "cve", "fixed_version", "status"},
+		nil,
+	)
+	aptVulnerabilitiesTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt", "vulnerabilities", "total"),
+		"How many outstanding CVEs affect installed APT packages, by severity.",
+		[]string{"severity"},
+		nil,
+	)
+)
+
+// CVECollector periodically fetches the Debian Security Tracker feed and
+// cross-references it against an exporter's installed-package cache to
+// expose outstanding vulnerabilities.
+type CVECollector struct {
+	feedURL  string
+	cacheDir string
+
+	// maxPerPackage bounds the cardinality of apt_package_vulnerabilities:
+	// once the number of outstanding findings exceeds it, only the
+	// aggregate apt_vulnerabilities_total is exposed.
+	maxPerPackage int
+
+	exporter *PackageManagerExporter
+
+	mu       sync.Mutex
+	findings []CVEFinding
+}
+
+// NewCVECollector returns a CVECollector fetching feedURL, caching it
+// under cacheDir, and cross-referencing it against e's installed-package
+// cache.
+func NewCVECollector(feedURL, cacheDir string, maxPerPackage int, e *PackageManagerExporter) *CVECollector {
+	return &CVECollector{
+		feedURL:       feedURL,
+		cacheDir:      cacheDir,
+		maxPerPackage: maxPerPackage,
+		exporter:      e,
+	}
+}
+
+func (c *CVECollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- aptPackageVulnerabilitiesDesc
+	ch <- aptVulnerabilitiesTotalDesc
+}
+func (c *CVECollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	fs := c.findings
+	c.mu.Unlock()
+
+	totals := map[string]int{}
+	for _, f := range fs {
+		totals[f.Severity]++
+	}
+
+	if len(fs) <= c.maxPerPackage {
+		for _, f := range fs {
+			ch <- prometheus.MustNewConstMetric(
+				aptPackageVulnerabilitiesDesc,
+				prometheus.GaugeValue,
+				1.0,
+				f.Package, f.Architecture, f.Severity, f.CVE, f.FixedVersion, f.Status,
+			)
+		}
+	} else {
+		log.Warnln(
+			"Outstanding CVE count", len(fs),
+			"exceeds --cve.max-package-series", c.maxPerPackage,
+			"- only exposing apt_vulnerabilities_total",
+		)
+	}
+
+	for severity, n := range totals {
+		ch <- prometheus.MustNewConstMetric(
+			aptVulnerabilitiesTotalDesc,
+			prometheus.GaugeValue,
+			float64(n),
+			severity,
+		)
+	}
+}
+
+// Poll refreshes the feed and recomputes findings every interval until
+// stop is closed.
+func (c *CVECollector) Poll(interval time.Duration, stop <-chan struct{}) {
+	if err := c.refresh(); err != nil {
+		log.Errorln(err)
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.refresh(); err != nil {
+				log.Errorln(err)
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *CVECollector) refresh() error {
+	// The Debian Security Tracker feed and the suite-matching logic in
+	// crossReferenceCVEs are Debian/APT-specific; other backends' suites
+	// never match a tracker release codename, so there is nothing
+	// meaningful to cross-reference.
+	if c.exporter.manager.Name() != "apt" {
+		return nil
+	}
+
+	feed, err := c.fetchFeed()
+	if err != nil {
+		return err
+	}
+
+	installed, f := c.exporter.cache.Get(CACHE_INSTALLED_PACKAGES)
+	if !f {
+		return fmt.Errorf("installed package cache is not yet populated")
+	}
+
+	fs := crossReferenceCVEs(feed, installed.([]*Package))
+
+	c.mu.Lock()
+	c.findings = fs
+	c.mu.Unlock()
+
+	log.Infoln("Cached", len(fs), "outstanding CVE findings")
+	return nil
+}
+
+// fetchFeed fetches the feed, honoring a cached ETag, and falls back to
+// the last cached copy on disk if the request fails or the server
+// returns anything other than 200/304 - so the exporter keeps reporting
+// (stale) findings rather than going blind when offline.
+func (c *CVECollector) fetchFeed() (debianSecurityTrackerFeed, error) {
+	if err := os.MkdirAll(c.cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	dataPath := filepath.Join(c.cacheDir, cveFeedCacheFile)
+	etagPath := filepath.Join(c.cacheDir, cveFeedETagFile)
+
+	req, err := http.NewRequest(http.MethodGet, c.feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if et, err := os.ReadFile(etagPath); err == nil {
+		req.Header.Set("If-None-Match", strings.TrimSpace(string(et)))
+	}
+
+	resp, err := cveHTTPClient.Do(req)
+	if err != nil {
+		log.Warnln("CVE feed fetch failed, falling back to cache:", err)
+		return readCachedCVEFeed(dataPath)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return readCachedCVEFeed(dataPath)
+
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Warnln("Reading CVE feed response failed, falling back to cache:", err)
+			return readCachedCVEFeed(dataPath)
+		}
+
+		var feed debianSecurityTrackerFeed
+		if err := json.Unmarshal(body, &feed); err != nil {
+			log.Warnln("Parsing CVE feed failed, falling back to cache:", err)
+			return readCachedCVEFeed(dataPath)
+		}
+
+		if err := os.WriteFile(dataPath, body, 0o644); err != nil {
+			log.Errorln(err)
+		}
+		if et := resp.Header.Get("ETag"); et != "" {
+			if err := os.WriteFile(etagPath, []byte(et), 0o644); err != nil {
+				log.Errorln(err)
+			}
+		}
+
+		return feed, nil
+
+	default:
+		log.Warnln("CVE feed returned", resp.Status, "- falling back to cache")
+		return readCachedCVEFeed(dataPath)
+	}
+}
+
+func readCachedCVEFeed(path string) (debianSecurityTrackerFeed, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed debianSecurityTrackerFeed
+	if err := json.Unmarshal(b, &feed); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// debianReleaseSuffixes are suite-name suffixes stripped when matching an
+// installed package's suite (e.g. "bullseye-security") against the
+// Debian Security Tracker's release codenames (e.g. "bullseye").
+var debianReleaseSuffixes = []string{"-security", "-updates", "-backports"}
+
+func baseDebianRelease(suite string) string {
+	for _, sfx := range debianReleaseSuffixes {
+		if strings.HasSuffix(suite, sfx) {
+			return strings.TrimSuffix(suite, sfx)
+		}
+	}
+
+	return suite
+}
+
+// crossReferenceCVEs compares installed package versions against feed,
+// returning one CVEFinding per (package, CVE) pair where the tracker
+// reports the installed suite as affected and not yet fixed at the
+// installed version.
+func crossReferenceCVEs(feed debianSecurityTrackerFeed, installed []*Package) []CVEFinding {
+	fs := []CVEFinding{}
+
+	for _, p := range installed {
+		cves, ok := feed[p.Name]
+		if !ok {
+			continue
+		}
+
+		for cve, entry := range cves {
+			for _, suite := range p.Suites {
+				rel, ok := entry.Releases[baseDebianRelease(suite)]
+				if !ok || rel.Status == "resolved" {
+					continue
+				}
+
+				if rel.FixedVersion != "" && dpkg.CompareVersions(p.Version, rel.FixedVersion) >= 0 {
+					continue
+				}
+
+				fs = append(fs, CVEFinding{
+					Package:      p.Name,
+					Architecture: p.Architecture,
+					CVE:          cve,
+					Severity:     normalizeCVESeverity(rel.Urgency),
+					FixedVersion: rel.FixedVersion,
+					Status:       rel.Status,
+				})
+
+				break
+			}
+		}
+	}
+
+	return fs
+}
+
+func normalizeCVESeverity(urgency string) string {
+	if urgency == "" {
+		return "unknown"
+	}
+
+	return urgency
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"regexp"
+)
+
+// dnfPackageManager supports both dnf and its predecessor yum, which share
+// the same `list` output format.
+type dnfPackageManager struct {
+	bin string
+}
+
+func newDnfPackageManager() PackageManager {
+	return &dnfPackageManager{bin: "dnf"}
+}
+
+func newYumPackageManager() PackageManager {
+	return &dnfPackageManager{bin: "yum"}
+}
+
+func (pm *dnfPackageManager) binary() string {
+	return pm.bin
+}
+
+func (pm *dnfPackageManager) Name() string {
+	return pm.bin
+}
+
+func (pm *dnfPackageManager) ListInstalled() ([]*Package, error) {
+	out, err := exec.Command(pm.bin, "list", "--installed").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDnfOutput(out), nil
+}
+
+func (pm *dnfPackageManager) ListUpgradeable() ([]*Package, error) {
+	out, err := exec.Command(pm.bin, "list", "--upgrades").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDnfOutput(out), nil
+}
+
+func (pm *dnfPackageManager) NeedsReboot() (bool, error) {
+	err := exec.Command("needs-restarting", "-r").Run()
+	if err == nil {
+		return false, nil
+	}
+
+	if _, ok := err.(*exec.ExitError); ok {
+		return true, nil
+	}
+
+	return false, err
+}
+
+func (pm *dnfPackageManager) WatchPaths() []string {
+	return []string{
+		"/var/lib/dnf",
+	}
+}
+
+// dnfLineRe matches a `dnf`/`yum` list entry, e.g.
+//
+//	bash.x86_64          5.1.8-4.fc35          @fedora
+var dnfLineRe = regexp.MustCompile(`^(\S+)\.(\S+)\s+(\S+)\s+(\S+)`)
+
+func parseDnfOutput(out []byte) []*Package {
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		ms := dnfLineRe.FindStringSubmatch(sc.Text())
+		if ms == nil {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:         ms[1],
+				Version:      ms[3],
+				Suites:       []string{ms[4]},
+				Architecture: ms[2],
+			},
+		)
+	}
+
+	return ps
+}
@@ -0,0 +1,61 @@
+package dpkg
+
+import "io"
+
+// Package is a single package record as found in dpkg's status file or an
+// APT Packages list.
+type Package struct {
+	Name         string
+	Version      string
+	Architecture string
+	Section      string
+	Origin       string
+	Suite        string
+	Priority     string
+
+	// Depends holds the Depends field verbatim (comma-separated
+	// alternatives, each optionally version-constrained and
+	// architecture-qualified), for callers that need to walk the
+	// dependency graph of installed packages.
+	Depends string
+
+	// Status holds dpkg's status field verbatim (e.g. "install ok
+	// installed"). It is only populated when parsing dpkg's status
+	// file; APT Packages lists do not carry it.
+	Status string
+}
+
+// ParsePackages streams Packages out of an RFC822-style dpkg status file
+// or APT Packages list. suite is attached to every returned Package,
+// since neither file format carries it as a per-stanza field; callers
+// parsing an APT Packages list typically derive it from that list's file
+// name.
+func ParsePackages(r io.Reader, suite string) ([]*Package, error) {
+	ps := []*Package{}
+
+	sc := NewStanzaScanner(r)
+	for sc.Scan() {
+		st := sc.Stanza()
+		if st["Package"] == "" {
+			continue
+		}
+
+		ps = append(ps, &Package{
+			Name:         st["Package"],
+			Version:      st["Version"],
+			Architecture: st["Architecture"],
+			Section:      st["Section"],
+			Origin:       st["Origin"],
+			Suite:        suite,
+			Priority:     st["Priority"],
+			Depends:      st["Depends"],
+			Status:       st["Status"],
+		})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
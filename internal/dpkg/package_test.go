@@ -0,0 +1,76 @@
+package dpkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePackages(t *testing.T) {
+	const status = `Package: bash
+Status: install ok installed
+Priority: required
+Section: shells
+Architecture: amd64
+Version: 5.1-2+deb11u1
+Depends: base-files (>= 2.1.12), debianutils (>= 2.15)
+
+Package: vim
+Status: install ok installed
+Priority: optional
+Architecture: amd64
+Version: 2:8.2.2434-3+deb11u1
+Description: Vi IMproved - enhanced vi editor
+ This is the Vi IMproved (vim), an enhanced version of the
+ standard Unix editor Vi.
+`
+
+	ps, err := ParsePackages(strings.NewReader(status), "bullseye")
+	if err != nil {
+		t.Fatalf("ParsePackages: %v", err)
+	}
+
+	if len(ps) != 2 {
+		t.Fatalf("got %d packages, want 2", len(ps))
+	}
+
+	bash := ps[0]
+	if bash.Name != "bash" || bash.Version != "5.1-2+deb11u1" || bash.Architecture != "amd64" {
+		t.Errorf("unexpected bash record: %+v", bash)
+	}
+	if bash.Status != "install ok installed" {
+		t.Errorf("bash.Status = %q", bash.Status)
+	}
+	if bash.Depends != "base-files (>= 2.1.12), debianutils (>= 2.15)" {
+		t.Errorf("bash.Depends = %q", bash.Depends)
+	}
+	if bash.Suite != "bullseye" {
+		t.Errorf("bash.Suite = %q, want bullseye", bash.Suite)
+	}
+
+	vim := ps[1]
+	if vim.Version != "2:8.2.2434-3+deb11u1" {
+		t.Errorf("vim.Version = %q", vim.Version)
+	}
+	if got := vim.Depends; got != "" {
+		t.Errorf("vim.Depends = %q, want empty", got)
+	}
+}
+
+func TestParsePackagesSkipsStanzasWithoutPackageField(t *testing.T) {
+	const status = `Version: 1.0
+Architecture: amd64
+
+Package: foo
+Version: 1.0
+Architecture: amd64
+`
+
+	ps, err := ParsePackages(strings.NewReader(status), "")
+	if err != nil {
+		t.Fatalf("ParsePackages: %v", err)
+	}
+
+	if len(ps) != 1 || ps[0].Name != "foo" {
+		t.Fatalf("got %+v, want a single foo package", ps)
+	}
+}
@@ -0,0 +1,87 @@
+// Package dpkg parses dpkg's status database and APT's Packages lists
+// directly, without shelling out to the apt/dpkg CLIs, and implements
+// dpkg's version-comparison algorithm.
+package dpkg
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Stanza is a single RFC822-style paragraph, as found in dpkg's status
+// file and in APT Packages lists, keyed by field name (e.g. "Package",
+// "Version"). Folded continuation lines are joined with "\n".
+type Stanza map[string]string
+
+// StanzaScanner reads successive Stanzas from an RFC822-style stream,
+// separated by blank lines. It follows the same Scan/Stanza/Err
+// conventions as bufio.Scanner.
+type StanzaScanner struct {
+	sc     *bufio.Scanner
+	stanza Stanza
+	err    error
+}
+
+// NewStanzaScanner returns a StanzaScanner reading from r.
+func NewStanzaScanner(r io.Reader) *StanzaScanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	return &StanzaScanner{sc: sc}
+}
+
+// Scan advances the scanner to the next stanza, returning false once the
+// stream is exhausted or an error occurs.
+func (s *StanzaScanner) Scan() bool {
+	st := Stanza{}
+	field := ""
+
+	for s.sc.Scan() {
+		l := s.sc.Text()
+
+		if strings.TrimSpace(l) == "" {
+			if len(st) > 0 {
+				s.stanza = st
+				return true
+			}
+
+			continue
+		}
+
+		if field != "" && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			st[field] += "\n" + strings.TrimSpace(l)
+			continue
+		}
+
+		i := strings.Index(l, ":")
+		if i < 0 {
+			continue
+		}
+
+		field = strings.TrimSpace(l[:i])
+		st[field] = strings.TrimSpace(l[i+1:])
+	}
+
+	if err := s.sc.Err(); err != nil {
+		s.err = err
+		return false
+	}
+
+	if len(st) > 0 {
+		s.stanza = st
+		return true
+	}
+
+	return false
+}
+
+// Stanza returns the stanza produced by the most recent call to Scan.
+func (s *StanzaScanner) Stanza() Stanza {
+	return s.stanza
+}
+
+// Err returns the first non-EOF error encountered while scanning.
+func (s *StanzaScanner) Err() error {
+	return s.err
+}
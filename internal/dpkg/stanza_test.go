@@ -0,0 +1,60 @@
+package dpkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStanzaScanner(t *testing.T) {
+	const input = `Package: vim
+Description: Vi IMproved - enhanced vi editor
+ This is the Vi IMproved (vim), an enhanced version of the
+ standard Unix editor Vi.
+
+Package: bash
+Version: 5.1-2
+`
+
+	sc := NewStanzaScanner(strings.NewReader(input))
+
+	if !sc.Scan() {
+		t.Fatalf("Scan: got false, want true (err: %v)", sc.Err())
+	}
+
+	st := sc.Stanza()
+	if st["Package"] != "vim" {
+		t.Errorf("Package = %q, want vim", st["Package"])
+	}
+
+	want := "Vi IMproved - enhanced vi editor\n" +
+		"This is the Vi IMproved (vim), an enhanced version of the\n" +
+		"standard Unix editor Vi."
+	if st["Description"] != want {
+		t.Errorf("Description = %q, want %q", st["Description"], want)
+	}
+
+	if !sc.Scan() {
+		t.Fatalf("Scan: got false on second stanza, want true (err: %v)", sc.Err())
+	}
+	if st2 := sc.Stanza(); st2["Package"] != "bash" || st2["Version"] != "5.1-2" {
+		t.Errorf("second stanza = %+v", st2)
+	}
+
+	if sc.Scan() {
+		t.Fatalf("Scan: got true after input exhausted")
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+}
+
+func TestStanzaScannerSkipsBlankLeadingLines(t *testing.T) {
+	sc := NewStanzaScanner(strings.NewReader("\n\nPackage: foo\n"))
+
+	if !sc.Scan() {
+		t.Fatalf("Scan: got false, want true (err: %v)", sc.Err())
+	}
+	if sc.Stanza()["Package"] != "foo" {
+		t.Errorf("Package = %q, want foo", sc.Stanza()["Package"])
+	}
+}
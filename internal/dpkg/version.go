@@ -0,0 +1,168 @@
+package dpkg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two Debian package version strings following
+// dpkg's algorithm and returns -1, 0 or 1 depending on whether a sorts
+// before, the same as, or after b.
+//
+// A version is "[epoch:]upstream-version[-debian-revision]". The epoch
+// is compared numerically, then the upstream version and Debian revision
+// are each compared by walking alternating non-digit/digit runs, where
+// non-digit runs compare character by character with "~" sorting before
+// everything (including the end of the run) and letters sorting before
+// non-letters, and digit runs compare numerically.
+func CompareVersions(a, b string) int {
+	ae, au := splitEpoch(a)
+	be, bu := splitEpoch(b)
+
+	if c := compareInt(ae, be); c != 0 {
+		return c
+	}
+
+	aup, arev := splitRevision(au)
+	bup, brev := splitRevision(bu)
+
+	if c := compareComponent(aup, bup); c != 0 {
+		return c
+	}
+
+	return compareComponent(arev, brev)
+}
+
+func splitEpoch(v string) (int, string) {
+	i := strings.Index(v, ":")
+	if i < 0 {
+		return 0, v
+	}
+
+	e, err := strconv.Atoi(v[:i])
+	if err != nil {
+		return 0, v
+	}
+
+	return e, v[i+1:]
+}
+
+func splitRevision(v string) (string, string) {
+	i := strings.LastIndex(v, "-")
+	if i < 0 {
+		return v, ""
+	}
+
+	return v[:i], v[i+1:]
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func spanNonDigit(s string) (string, string) {
+	i := 0
+	for i < len(s) && !isDigit(s[i]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func spanDigit(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+// compareComponent compares an upstream version or Debian revision,
+// walking alternating non-digit/digit runs until both are exhausted.
+func compareComponent(a, b string) int {
+	for len(a) > 0 || len(b) > 0 {
+		var an, bn string
+		an, a = spanNonDigit(a)
+		bn, b = spanNonDigit(b)
+
+		if c := compareRun(an, bn); c != 0 {
+			return c
+		}
+
+		var ad, bd string
+		ad, a = spanDigit(a)
+		bd, b = spanDigit(b)
+
+		if c := compareInt(atoiOrZero(ad), atoiOrZero(bd)); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// compareRun compares two non-digit runs character by character using
+// dpkg's ordering: "~" sorts before everything, even the end of a run,
+// letters sort before non-letters, and otherwise ASCII order applies.
+func compareRun(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ca, cb int
+
+		if i < len(a) {
+			ca = runeOrder(a[i])
+		}
+		if i < len(b) {
+			cb = runeOrder(b[i])
+		}
+
+		if ca != cb {
+			return compareInt(ca, cb)
+		}
+	}
+
+	return 0
+}
+
+// runeOrder ranks a single byte: "~" is lowest, the implicit end of a
+// run (rank 0, used above whenever a run is shorter than the other)
+// comes next, then letters, then everything else.
+func runeOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case isAlpha(c):
+		return 1000 + int(c)
+	default:
+		return 2000 + int(c)
+	}
+}
+
+func atoiOrZero(s string) int {
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
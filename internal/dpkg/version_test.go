@@ -0,0 +1,43 @@
+package dpkg
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"1:1.0", "2.0", 1},
+		{"1.0", "1:0.1", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-2", "1.0-1", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0", "1.0~rc1", 1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0~", 1},
+		{"1.0", "1.0.1", -1},
+		{"7.2p2", "7.2", 1},
+		{"1.0-3", "1.0-3", 0},
+		{"2:1.0-3", "1:9.9-9", 1},
+		{"5.1-2", "5.1-2+deb11u1", -1},
+		{"009", "9", 0},
+		{"009", "010", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+
+		// CompareVersions must be antisymmetric.
+		if tt.want != 0 {
+			if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// Package describes a single package as reported by a PackageManager.
+type Package struct {
+	Name         string
+	Version      string
+	Suites       []string
+	Architecture string
+
+	// Origin is the host that serves the package's repository, when
+	// known (e.g. "security.debian.org"). Backends that cannot resolve
+	// it leave it empty.
+	Origin string
+
+	// Security reports whether the package's update addresses a
+	// security issue. Backends that cannot classify updates this way
+	// leave it false.
+	Security bool
+}
+
+// PackageManager abstracts over a system's native package manager so that
+// AptExporter-derived code can collect uniform metrics regardless of the
+// underlying distribution.
+type PackageManager interface {
+	// Name returns the identifier used for the "manager" metric label
+	// (e.g. "apt", "dnf", "pacman", "apk", "zypper").
+	Name() string
+
+	// ListInstalled returns every package currently installed on the system.
+	ListInstalled() ([]*Package, error)
+
+	// ListUpgradeable returns every package for which a newer version is
+	// available.
+	ListUpgradeable() ([]*Package, error)
+
+	// NeedsReboot reports whether the system should be restarted to apply
+	// an already-installed update.
+	NeedsReboot() (bool, error)
+
+	// WatchPaths returns the filesystem paths that should be watched for
+	// changes that invalidate the package manager's caches.
+	WatchPaths() []string
+
+	// binary returns the name of the executable used to detect whether
+	// this package manager is present on the host.
+	binary() string
+}
+
+// packageManagers lists the supported backends in detection order.
+var packageManagers = []func() PackageManager{
+	newAptPackageManager,
+	newDnfPackageManager,
+	newYumPackageManager,
+	newPacmanPackageManager,
+	newApkPackageManager,
+	newZypperPackageManager,
+}
+
+// detectPackageManager probes the host for a supported package manager
+// binary, in the order it is most likely to be found, and returns the first
+// match.
+func detectPackageManager() (PackageManager, error) {
+	for _, f := range packageManagers {
+		pm := f()
+
+		if _, err := exec.LookPath(pm.binary()); err == nil {
+			return pm, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no supported package manager found")
+}
+
+func unique(src []string) []string {
+	dst := []string{}
+
+	mm := map[string]bool{}
+	for _, v := range src {
+		if !mm[v] {
+			mm[v] = true
+			dst = append(dst, v)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"regexp"
+)
+
+type pacmanPackageManager struct{}
+
+func newPacmanPackageManager() PackageManager {
+	return &pacmanPackageManager{}
+}
+
+func (pm *pacmanPackageManager) binary() string {
+	return "pacman"
+}
+
+func (pm *pacmanPackageManager) Name() string {
+	return "pacman"
+}
+
+// pacmanInstalledRe matches a `pacman -Q` entry, e.g. "bash 5.1.016-1".
+var pacmanInstalledRe = regexp.MustCompile(`^(\S+) (\S+)`)
+
+func (pm *pacmanPackageManager) ListInstalled() ([]*Package, error) {
+	out, err := exec.Command("pacman", "-Q").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		ms := pacmanInstalledRe.FindStringSubmatch(sc.Text())
+		if ms == nil {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:    ms[1],
+				Version: ms[2],
+				// pacman -Q does not report the repository a package
+				// came from; "local" reflects the local package
+				// database it is read from.
+				Suites: []string{"local"},
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+// pacmanUpgradeableRe matches a `pacman -Qu` entry, e.g.
+//
+//	bash 5.1.016-1 -> 5.1.016-2
+var pacmanUpgradeableRe = regexp.MustCompile(`^(\S+) \S+ -> (\S+)`)
+
+func (pm *pacmanPackageManager) ListUpgradeable() ([]*Package, error) {
+	out, err := exec.Command("pacman", "-Qu").Output()
+	if err != nil {
+		// pacman -Qu exits non-zero when there is nothing to upgrade.
+		if _, ok := err.(*exec.ExitError); ok && len(out) == 0 {
+			return []*Package{}, nil
+		}
+
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		ms := pacmanUpgradeableRe.FindStringSubmatch(sc.Text())
+		if ms == nil {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:    ms[1],
+				Version: ms[2],
+				Suites:  []string{"local"},
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+func (pm *pacmanPackageManager) NeedsReboot() (bool, error) {
+	// Arch Linux does not ship a reboot-required marker; a running kernel
+	// that no longer matches the installed linux package is the closest
+	// equivalent, but pacman does not expose that comparison directly.
+	return false, nil
+}
+
+func (pm *pacmanPackageManager) WatchPaths() []string {
+	return []string{
+		"/var/lib/pacman/local",
+	}
+}
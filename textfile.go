@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// writeTextfile gathers the metrics exposed by reg and atomically writes
+// them to path in the format expected by node_exporter's textfile
+// collector, so that a cron/systemd-timer one-shot run can be consumed
+// without a long-lived HTTP daemon.
+func writeTextfile(reg prometheus.Gatherer, path string) error {
+	mfs, err := reg.Gather()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(tmp, mf); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	// os.CreateTemp creates the file 0600. apt_exporter commonly runs as
+	// root while node_exporter's textfile collector commonly runs as an
+	// unprivileged user, so the output must be made world-readable for it
+	// to be ingested at all.
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/pmaene/apt_exporter/internal/dpkg"
+)
+
+// updateHTTPClient bounds how long a feed check may take, so a stalled
+// connection cannot block the poller indefinitely.
+var updateHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// updateDownloadClient affords a release binary download more time than
+// a feed check.
+var updateDownloadClient = &http.Client{Timeout: 5 * time.Minute}
+
+var (
+	updateAvailableDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt_exporter", "", "update_available"),
+		"Whether a newer apt_exporter release is available.",
+		[]string{"current", "latest"},
+		nil,
+	)
+	updateLastCheckDesc = prometheus.NewDesc(
+		prometheus.BuildFQName("apt_exporter", "", "update_last_check_timestamp_seconds"),
+		"Unix timestamp of the last release-feed check.",
+		nil,
+		nil,
+	)
+)
+
+// release is the document served by the configured release feed.
+type release struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	Sig     string `json:"sig"`
+}
+
+// Updater polls a release feed for new apt_exporter versions and, via
+// ServeHTTP, can fetch and apply one in place: verifying its checksum and
+// signature, replacing the running binary and re-exec'ing into it.
+type Updater struct {
+	feedURL string
+	channel string
+	pubKey  ed25519.PublicKey
+	token   string
+
+	current string
+
+	mu        sync.Mutex
+	latest    string
+	lastCheck time.Time
+}
+
+// NewUpdater returns an Updater that checks feedURL for updates on the
+// given channel, verifying releases against pubKey, and authenticates
+// POST /-/upgrade requests against token.
+func NewUpdater(feedURL, channel string, pubKey ed25519.PublicKey, token, current string) *Updater {
+	return &Updater{
+		feedURL: feedURL,
+		channel: channel,
+		pubKey:  pubKey,
+		token:   token,
+		current: current,
+	}
+}
+
+func (u *Updater) Describe(ch chan<- *prometheus.Desc) {
+	ch <- updateAvailableDesc
+	ch <- updateLastCheckDesc
+}
+func (u *Updater) Collect(ch chan<- prometheus.Metric) {
+	u.mu.Lock()
+	latest, lastCheck := u.latest, u.lastCheck
+	u.mu.Unlock()
+
+	if !lastCheck.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			updateLastCheckDesc,
+			prometheus.GaugeValue,
+			float64(lastCheck.Unix()),
+		)
+	}
+
+	available := 0.0
+	if latest != "" && latest != u.current {
+		available = 1.0
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		updateAvailableDesc,
+		prometheus.GaugeValue,
+		available,
+		u.current,
+		latest,
+	)
+}
+
+// Poll checks the release feed every interval until stop is closed.
+func (u *Updater) Poll(interval time.Duration, stop <-chan struct{}) {
+	if err := u.check(); err != nil {
+		log.Errorln(err)
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := u.check(); err != nil {
+				log.Errorln(err)
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (u *Updater) check() error {
+	r, err := u.fetchRelease()
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	u.latest = r.Version
+	u.lastCheck = time.Now()
+	u.mu.Unlock()
+
+	return nil
+}
+
+func (u *Updater) fetchRelease() (*release, error) {
+	feedURL, err := u.channelFeedURL()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := updateHTTPClient.Get(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release feed %s returned %s", feedURL, resp.Status)
+	}
+
+	var r release
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// channelFeedURL returns u.feedURL with a "channel" query parameter set to
+// u.channel, so a single release feed can serve different releases per
+// channel (e.g. stable vs. unstable).
+func (u *Updater) channelFeedURL() (string, error) {
+	parsed, err := url.Parse(u.feedURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid --update.feed-url %q: %w", u.feedURL, err)
+	}
+
+	q := parsed.Query()
+	q.Set("channel", u.channel)
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String(), nil
+}
+
+// ServeHTTP handles POST /-/upgrade: it checks the bearer token, fetches
+// the latest release, verifies its checksum and signature against the
+// pinned public key, atomically replaces the running binary and re-execs
+// into it.
+func (u *Updater) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !u.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rel, err := u.fetchRelease()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if err := u.apply(rel); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "upgraded to %s\n", rel.Version)
+
+	log.Infoln("Upgraded to", rel.Version, "- re-executing")
+	if err := reexec(); err != nil {
+		log.Errorln(err)
+	}
+}
+
+func (u *Updater) authorized(r *http.Request) bool {
+	if u.token == "" {
+		return false
+	}
+
+	const prefix = "Bearer "
+
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(
+		[]byte(strings.TrimPrefix(h, prefix)),
+		[]byte(u.token),
+	) == 1
+}
+
+// apply downloads rel's binary, verifies it is newer than the running
+// version, verifies its checksum and detached signature, then atomically
+// replaces the currently running executable with it.
+func (u *Updater) apply(rel *release) error {
+	if dpkg.CompareVersions(rel.Version, u.current) <= 0 {
+		return fmt.Errorf("refusing to apply %s: not newer than the running version %s", rel.Version, u.current)
+	}
+
+	body, err := downloadRelease(rel.URL)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(rel.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s", rel.URL)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(rel.Sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if !ed25519.Verify(u.pubKey, sum[:], sig) {
+		return fmt.Errorf("signature verification failed for %s", rel.URL)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	return replaceExecutable(exe, body)
+}
+
+func downloadRelease(url string) ([]byte, error) {
+	resp, err := updateDownloadClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download of %s returned %s", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// replaceExecutable atomically swaps path's contents for body, preserving
+// its file mode, via a temp file in the same directory plus a rename.
+func replaceExecutable(path string, body []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".apt_exporter-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// reexec replaces the current process image with the (now updated)
+// executable at its own path, carrying over argv and the environment.
+// This assumes a POSIX host, which holds for every system apt_exporter
+// otherwise supports.
+func reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// loadUpdatePubKey reads a base64-encoded ed25519 public key from path.
+func loadUpdatePubKey(path string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	if len(k) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s does not contain a valid ed25519 public key", path)
+	}
+
+	return ed25519.PublicKey(k), nil
+}
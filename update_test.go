@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustGenerateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+
+	return pub, priv
+}
+
+func signedRelease(t *testing.T, priv ed25519.PrivateKey, url string, body []byte) *release {
+	t.Helper()
+
+	sum := sha256.Sum256(body)
+
+	return &release{
+		Version: "1.1.0",
+		URL:     url,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Sig:     base64.StdEncoding.EncodeToString(ed25519.Sign(priv, sum[:])),
+	}
+}
+
+func TestUpdaterApplyRejectsChecksumMismatch(t *testing.T) {
+	body := []byte("new binary contents")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	pub, priv := mustGenerateKey(t)
+	rel := signedRelease(t, priv, srv.URL, body)
+	rel.SHA256 = strings.Repeat("0", 64)
+
+	u := &Updater{pubKey: pub, current: "1.0.0"}
+
+	err := u.apply(rel)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("apply() = %v, want a checksum mismatch error", err)
+	}
+}
+
+func TestUpdaterApplyRejectsBadSignature(t *testing.T) {
+	body := []byte("new binary contents")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	pub, _ := mustGenerateKey(t)
+	_, otherPriv := mustGenerateKey(t)
+	rel := signedRelease(t, otherPriv, srv.URL, body)
+
+	u := &Updater{pubKey: pub, current: "1.0.0"}
+
+	err := u.apply(rel)
+	if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Fatalf("apply() = %v, want a signature verification error", err)
+	}
+}
+
+func TestUpdaterApplyRejectsNonNewerVersion(t *testing.T) {
+	pub, priv := mustGenerateKey(t)
+
+	tests := []struct {
+		current, release string
+	}{
+		{"1.1.0", "1.1.0"},
+		{"1.1.0", "1.0.0"},
+		{"2:1.0.0", "1.0.0"},
+	}
+
+	for _, tt := range tests {
+		body := []byte("new binary contents")
+		rel := signedRelease(t, priv, "http://unused.invalid", body)
+		rel.Version = tt.release
+
+		u := &Updater{pubKey: pub, current: tt.current}
+
+		err := u.apply(rel)
+		if err == nil || !strings.Contains(err.Error(), "not newer") {
+			t.Errorf("apply() with current=%q release=%q = %v, want a not-newer error", tt.current, tt.release, err)
+		}
+	}
+}
+
+func TestUpdaterAuthorized(t *testing.T) {
+	u := &Updater{token: "s3cr3t"}
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"valid bearer token", "Bearer s3cr3t", true},
+		{"wrong token", "Bearer wrong", false},
+		{"missing prefix", "s3cr3t", false},
+		{"no header", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/-/upgrade", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			if got := u.authorized(r); got != tt.want {
+				t.Errorf("authorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdaterAuthorizedRejectsEverythingWithNoTokenConfigured(t *testing.T) {
+	u := &Updater{token: ""}
+
+	r := httptest.NewRequest(http.MethodPost, "/-/upgrade", nil)
+	r.Header.Set("Authorization", "Bearer anything")
+
+	if u.authorized(r) {
+		t.Fatalf("authorized() = true with no token configured, want false")
+	}
+}
+
+func TestChannelFeedURL(t *testing.T) {
+	u := &Updater{feedURL: "https://example.com/feed?foo=bar", channel: "unstable"}
+
+	got, err := u.channelFeedURL()
+	if err != nil {
+		t.Fatalf("channelFeedURL: %v", err)
+	}
+
+	if !strings.Contains(got, "channel=unstable") {
+		t.Errorf("channelFeedURL() = %q, want it to contain channel=unstable", got)
+	}
+	if !strings.Contains(got, "foo=bar") {
+		t.Errorf("channelFeedURL() = %q, want it to preserve the existing foo=bar param", got)
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "apt_exporter")
+
+	if err := os.WriteFile(path, []byte("old"), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatalf("replaceExecutable: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "new" {
+		t.Errorf("file contents = %q, want %q", got, "new")
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Mode().Perm() != 0o755 {
+		t.Errorf("mode = %v, want the original 0755 preserved", fi.Mode().Perm())
+	}
+}
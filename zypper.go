@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type zypperPackageManager struct{}
+
+func newZypperPackageManager() PackageManager {
+	return &zypperPackageManager{}
+}
+
+func (pm *zypperPackageManager) binary() string {
+	return "zypper"
+}
+
+func (pm *zypperPackageManager) Name() string {
+	return "zypper"
+}
+
+func (pm *zypperPackageManager) ListInstalled() ([]*Package, error) {
+	out, err := exec.Command(
+		"zypper", "--non-interactive", "packages", "--installed-only",
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fs := splitZypperRow(sc.Text())
+		if len(fs) < 5 || !isZypperStatusColumn(fs[0]) {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:         fs[2],
+				Version:      fs[3],
+				Suites:       []string{fs[1]},
+				Architecture: fs[4],
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+func (pm *zypperPackageManager) ListUpgradeable() ([]*Package, error) {
+	out, err := exec.Command(
+		"zypper", "--non-interactive", "list-updates",
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := []*Package{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fs := splitZypperRow(sc.Text())
+		if len(fs) < 6 || !isZypperStatusColumn(fs[0]) {
+			continue
+		}
+
+		ps = append(
+			ps,
+			&Package{
+				Name:         fs[2],
+				Version:      fs[4],
+				Suites:       []string{fs[1]},
+				Architecture: fs[5],
+			},
+		)
+	}
+
+	return ps, nil
+}
+
+func (pm *zypperPackageManager) NeedsReboot() (bool, error) {
+	_, err := os.Stat("/var/run/reboot-needed")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (pm *zypperPackageManager) WatchPaths() []string {
+	return []string{
+		"/var/cache/zypp",
+	}
+}
+
+// splitZypperRow splits a row of zypper's `|`-delimited table output (as
+// produced by `packages`/`list-updates`) and trims each field.
+func splitZypperRow(line string) []string {
+	if !strings.Contains(line, "|") {
+		return nil
+	}
+
+	raw := strings.Split(line, "|")
+	fs := make([]string, len(raw))
+	for i, f := range raw {
+		fs[i] = strings.TrimSpace(f)
+	}
+
+	return fs
+}
+
+// isZypperStatusColumn reports whether s is one of the single-character
+// status codes zypper prints in the leading column of
+// `packages`/`list-updates` output (e.g. "i" for installed, "v" for a
+// version update). The header row above the data has the same field count
+// but a literal "S" there instead, so this - not field count alone - is
+// what actually filters the header out.
+func isZypperStatusColumn(s string) bool {
+	switch s {
+	case "i", "i+", "v":
+		return true
+	default:
+		return false
+	}
+}